@@ -0,0 +1,330 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// logFS is the minimal filesystem surface ViewPath needs. diskFS
+// implements it directly against the configured log directory; tarFS
+// and zipFS implement it against the contents of an archive found
+// along the way, so a URL like /2024/logs.tar.gz/server/foo.log can be
+// resolved transparently without the rest of the code caring where the
+// bytes actually come from.
+type logFS interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Open(name string) (io.ReadCloser, error)
+}
+
+// isArchiveExt reports whether name should be entered as a virtual
+// directory rather than served as a plain log file.
+func isArchiveExt(name string) bool {
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return true
+	case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".zip"):
+		return true
+	default:
+		return false
+	}
+}
+
+// resolve walks urlPath against the configured log directory,
+// descending into any archive it finds along the way, and returns the
+// filesystem the final path component lives in together with that
+// path relative to it.
+func resolve(urlPath string) (logFS, string, error) {
+	var fsys logFS = diskFS{base: viper.GetString("enview.log.dir")}
+	parts := strings.Split(strings.Trim(urlPath, "/"), "/")
+	if len(parts) == 1 && parts[0] == "" {
+		parts = nil
+	}
+	return resolveParts(fsys, parts)
+}
+
+func resolveParts(fsys logFS, parts []string) (logFS, string, error) {
+	for i := 0; i < len(parts); i++ {
+		candidate := strings.Join(parts[:i+1], "/")
+		info, err := fsys.Stat(candidate)
+		if err != nil {
+			return nil, "", err
+		}
+		if info.IsDir() {
+			continue
+		}
+		if isArchiveExt(candidate) {
+			sub, err := openArchiveFS(fsys, candidate)
+			if err != nil {
+				return nil, "", err
+			}
+			return resolveParts(sub, parts[i+1:])
+		}
+		if i != len(parts)-1 {
+			return nil, "", os.ErrNotExist
+		}
+		return fsys, candidate, nil
+	}
+	return fsys, "", nil
+}
+
+func openArchiveFS(fsys logFS, name string) (logFS, error) {
+	rc, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		bs, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(bs), int64(len(bs)))
+		if err != nil {
+			return nil, err
+		}
+		return newZipFS(zr)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return newTarFS(gz)
+	case strings.HasSuffix(name, ".tar"):
+		return newTarFS(rc)
+	default:
+		return nil, fmt.Errorf("unsupported archive type: %s", name)
+	}
+}
+
+// diskFS implements logFS directly against a directory on disk. Plain
+// ".gz" files (but not ".tar.gz"/".tgz", which are handled as archives
+// before Open is ever called on the compressed stream) are transparently
+// decompressed on Open.
+type diskFS struct {
+	base string
+}
+
+func (d diskFS) join(name string) string {
+	return filepath.Join(d.base, filepath.FromSlash(name))
+}
+
+func (d diskFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(d.join(name))
+}
+
+func (d diskFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(d.join(name))
+}
+
+func (d diskFS) Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(d.join(name))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(name, ".gz") && !isArchiveExt(name) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return gzFile{gz: gz, f: f}, nil
+	}
+	return f, nil
+}
+
+// gzFile closes both the gzip.Reader and the underlying file it reads
+// from.
+type gzFile struct {
+	gz *gzip.Reader
+	f  *os.File
+}
+
+func (g gzFile) Read(p []byte) (int, error) { return g.gz.Read(p) }
+
+func (g gzFile) Close() error {
+	gzErr := g.gz.Close()
+	fErr := g.f.Close()
+	if gzErr != nil {
+		return gzErr
+	}
+	return fErr
+}
+
+// memEntry is one non-directory entry in an in-memory archive-backed
+// logFS: its stat info plus its fully-read contents.
+type memEntry struct {
+	info fs.FileInfo
+	data []byte
+}
+
+// memFS is a logFS over archive entries that have already been fully
+// read into memory, used by both tarFS and zipFS. Directories are
+// tracked explicitly (from the archive's own entries where present,
+// and synthesized from slashes in file names otherwise) so ReadDir
+// works even for archives that don't store directory entries.
+type memFS struct {
+	entries map[string]memEntry
+	dirs    map[string]bool
+}
+
+func newMemFS() *memFS {
+	return &memFS{entries: map[string]memEntry{}, dirs: map[string]bool{"": true}}
+}
+
+func cleanEntryName(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+func (m *memFS) addDir(name string) {
+	name = cleanEntryName(name)
+	if name == "." {
+		return
+	}
+	m.dirs[name] = true
+}
+
+func (m *memFS) addFile(name string, info fs.FileInfo, data []byte) {
+	name = cleanEntryName(name)
+	m.entries[name] = memEntry{info: info, data: data}
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		m.dirs[dir] = true
+	}
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	name = cleanEntryName(name)
+	if name == "." {
+		name = ""
+	}
+	if e, ok := m.entries[name]; ok {
+		return e.info, nil
+	}
+	if m.dirs[name] {
+		return dirInfo(path.Base(name)), nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = cleanEntryName(name)
+	if name == "." {
+		name = ""
+	}
+	children := map[string]fs.FileInfo{}
+	add := func(full string, info fs.FileInfo) {
+		rel := full
+		if name != "" {
+			if full != name && !strings.HasPrefix(full, name+"/") {
+				return
+			}
+			rel = strings.TrimPrefix(full, name)
+			rel = strings.TrimPrefix(rel, "/")
+		}
+		if rel == "" {
+			return
+		}
+		if idx := strings.Index(rel, "/"); idx >= 0 {
+			base := rel[:idx]
+			if _, ok := children[base]; !ok {
+				children[base] = dirInfo(base)
+			}
+		} else {
+			children[rel] = info
+		}
+	}
+	for dir := range m.dirs {
+		if dir == "" {
+			continue
+		}
+		add(dir, dirInfo(path.Base(dir)))
+	}
+	for fname, e := range m.entries {
+		add(fname, e.info)
+	}
+	out := make([]fs.DirEntry, 0, len(children))
+	for _, info := range children {
+		out = append(out, fs.FileInfoToDirEntry(info))
+	}
+	return out, nil
+}
+
+func (m *memFS) Open(name string) (io.ReadCloser, error) {
+	name = cleanEntryName(name)
+	e, ok := m.entries[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(e.data)), nil
+}
+
+// dirInfo is a synthetic fs.FileInfo for a directory entry that an
+// archive didn't store explicitly.
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0755 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
+
+func newTarFS(r io.Reader) (*memFS, error) {
+	m := newMemFS()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			m.addDir(hdr.Name)
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		m.addFile(hdr.Name, hdr.FileInfo(), data)
+	}
+	return m, nil
+}
+
+func newZipFS(r *zip.Reader) (*memFS, error) {
+	m := newMemFS()
+	for _, zf := range r.File {
+		if zf.FileInfo().IsDir() {
+			m.addDir(zf.Name)
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		m.addFile(zf.Name, zf.FileInfo(), data)
+	}
+	return m, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTar(t *testing.T, w io.Writer, files map[string]string) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Size: int64(len(content)), Mode: 0644}
+		assert.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+}
+
+func writeZip(t *testing.T, w io.Writer, files map[string]string) {
+	t.Helper()
+	zw := zip.NewWriter(w)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+}
+
+func TestTarFSResolvesNestedEntries(t *testing.T) {
+	var buf bytes.Buffer
+	writeTar(t, &buf, map[string]string{"server/foo.log": "hello"})
+
+	fsys, err := newTarFS(&buf)
+	assert.NoError(t, err)
+
+	info, err := fsys.Stat("server")
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	entries, err := fsys.ReadDir("server")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "foo.log", entries[0].Name())
+
+	rc, err := fsys.Open("server/foo.log")
+	assert.NoError(t, err)
+	defer rc.Close()
+	bs, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(bs))
+}
+
+func TestZipFSResolvesNestedEntries(t *testing.T) {
+	var buf bytes.Buffer
+	writeZip(t, &buf, map[string]string{"server/foo.log": "hello"})
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	fsys, err := newZipFS(zr)
+	assert.NoError(t, err)
+
+	entries, err := fsys.ReadDir("server")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	rc, err := fsys.Open("server/foo.log")
+	assert.NoError(t, err)
+	defer rc.Close()
+	bs, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(bs))
+}
+
+func TestResolveDescendsIntoArchive(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "logs.tar"))
+	assert.NoError(t, err)
+	writeTar(t, f, map[string]string{"server/foo.log": "hello"})
+	assert.NoError(t, f.Close())
+
+	orig := viper.GetString("enview.log.dir")
+	viper.Set("enview.log.dir", dir)
+	defer viper.Set("enview.log.dir", orig)
+
+	fsys, p, err := resolve("/logs.tar/server/foo.log")
+	assert.NoError(t, err)
+	rc, err := fsys.Open(p)
+	assert.NoError(t, err)
+	defer rc.Close()
+	bs, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(bs))
+}
+
+func TestDiskFSDecompressesPlainGzLogs(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "foo.log.gz"))
+	assert.NoError(t, err)
+	gw := gzip.NewWriter(f)
+	_, err = gw.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, gw.Close())
+	assert.NoError(t, f.Close())
+
+	fsys := diskFS{base: dir}
+	rc, err := fsys.Open("foo.log.gz")
+	assert.NoError(t, err)
+	defer rc.Close()
+	bs, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(bs))
+}
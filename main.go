@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io/ioutil"
@@ -9,8 +11,8 @@ import (
 	"net/http"
 	"os"
 	"path"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -23,6 +25,21 @@ func init() {
 	pflag.StringVar(&cfgFile, "config", "", "config file, default: $HOME/.enview.toml")
 	viper.SetDefault("enview.log.dir", "./logs")
 	viper.SetDefault("httpd.template.dir", "./public/templates")
+	viper.SetDefault("enview.palette", "xterm")
+}
+
+// selectedPalette returns the palette a request asked for via
+// ?palette=, falling back to the enview.palette config key and then to
+// DefaultPalette if neither names a registered palette.
+func selectedPalette(r *http.Request) *Palette {
+	name := r.URL.Query().Get("palette")
+	if name == "" {
+		name = viper.GetString("enview.palette")
+	}
+	if p, ok := LookupPalette(name); ok {
+		return p
+	}
+	return DefaultPalette
 }
 
 func initializeConfig(cfgFile string) error {
@@ -45,44 +62,74 @@ func main() {
 		log.Fatalf("error initializing config: %v", err)
 	}
 
+	if err := initSearchIndex(); err != nil {
+		log.Println("search: init:", err)
+	}
+
 	http.Handle("/", http.HandlerFunc(ViewPath))
 	http.Handle("/favicon.ico", http.HandlerFunc(http.NotFound))
 	http.Handle("/search/", http.StripPrefix("/search", http.HandlerFunc(SearchPath)))
+	http.Handle("/tail/", http.StripPrefix("/tail", http.HandlerFunc(TailPath)))
 	http.ListenAndServe(":8080", nil)
 }
 
-func SearchPath(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Search Path: [%v]\n", r.URL.Path)
-}
-
 func ViewPath(w http.ResponseWriter, r *http.Request) {
 	crumbs := breadcrumbs(r)
-	p := logPath(r.URL.Path)
-	if isDir, err := isDirectory(p); err != nil {
-		internalServerError(w, "isDirectory", err)
+	fsys, p, err := resolve(r.URL.Path)
+	if err != nil {
+		internalServerError(w, "resolve", err)
 		return
-	} else if isDir {
-		dirs, files, err := readDir(p, r.URL.Path)
+	}
+	info, err := fsys.Stat(p)
+	if err != nil {
+		internalServerError(w, "stat", err)
+		return
+	}
+	if info.IsDir() {
+		dirs, files, err := readDir(fsys, p, r.URL.Path)
 		if err != nil {
 			internalServerError(w, "readDir", err)
 			return
 		}
-		sort.Sort(sort.Reverse(directorySort(dirs)))
-		sort.Sort(sort.Reverse(fileSort(files)))
+		params := parseListParams(r)
+		sortDirs(dirs, params.sort, params.desc)
+		sortFiles(files, params.sort, params.desc)
+
+		switch params.format {
+		case "json":
+			writeDirJSON(w, dirs, files)
+			return
+		case "csv":
+			writeDirCSV(w, dirs, files)
+			return
+		}
+
+		page, itemsLimitedTo := paginate(files, params.limit, params.offset)
 		renderView(w, r, "directory", nil, map[string]interface{}{
-			"Crumbs": crumbs,
-			"Dirs":   dirs,
-			"Files":  files,
-			"Path":   r.URL.Path,
+			"Crumbs":         crumbs,
+			"Dirs":           dirs,
+			"Files":          page,
+			"Path":           r.URL.Path,
+			"Prev":           prevURL(r, params),
+			"Next":           nextURL(r, params, len(files)),
+			"ItemsLimitedTo": itemsLimitedTo,
 		})
 	} else {
-		html, err := parseLog(p)
+		palette := selectedPalette(r)
+		useClasses := r.URL.Query().Get("classes") == "1"
+		html, err := parseLog(fsys, p, WithPalette(palette), Classes(useClasses))
 		if err != nil {
 			internalServerError(w, "parseLog", err)
 		}
 		renderView(w, r, "log", nil, map[string]interface{}{
-			"Crumbs": crumbs,
-			"HTML":   html,
+			"Crumbs":     crumbs,
+			"HTML":       html,
+			"Palette":    palette.Name,
+			"PaletteCSS": template.CSS(PaletteCSS(palette)),
+			// Follow tells the log template whether to connect an
+			// EventSource to TailPath (at the same path, under
+			// /tail/) instead of leaving the rendered HTML static.
+			"Follow": r.URL.Query().Get("follow") == "1",
 		})
 	}
 }
@@ -92,23 +139,181 @@ type directory struct {
 	Name string
 }
 
-type directorySort []directory
-
-func (a directorySort) Len() int           { return len(a) }
-func (a directorySort) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a directorySort) Less(i, j int) bool { return a[i].Name < a[j].Name }
-
 type file struct {
 	Path  string
 	Name  string
 	Mtime time.Time
+	Size  int64
 }
 
-type fileSort []file
+// listParams holds the query-string knobs that control how a directory
+// listing is sorted, paginated, and rendered.
+type listParams struct {
+	sort   string // "name", "size", or "time"; "" picks the field's own default
+	desc   bool
+	limit  int
+	offset int
+	format string // "", "json", or "csv"
+}
 
-func (a fileSort) Len() int           { return len(a) }
-func (a fileSort) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a fileSort) Less(i, j int) bool { return a[i].Mtime.Before(a[j].Mtime) }
+func parseListParams(r *http.Request) listParams {
+	q := r.URL.Query()
+	params := listParams{
+		sort:   q.Get("sort"),
+		desc:   q.Get("order") != "asc",
+		format: q.Get("format"),
+	}
+	params.limit, _ = strconv.Atoi(q.Get("limit"))
+	params.offset, _ = strconv.Atoi(q.Get("offset"))
+	if params.offset < 0 {
+		params.offset = 0
+	}
+	return params
+}
+
+// sortDirs sorts dirs by name; directories have no size or mtime of their
+// own, so those keys fall back to name as well. Defaults to descending,
+// matching the original A-Z listing order.
+func sortDirs(dirs []directory, _ string, desc bool) {
+	sort.Slice(dirs, func(i, j int) bool {
+		if desc {
+			i, j = j, i
+		}
+		return dirs[i].Name < dirs[j].Name
+	})
+}
+
+// sortFiles sorts files by the given key ("name", "size", or "time"),
+// defaulting to "time" (mtime, newest first) to match the original
+// behavior when no ?sort= param is given.
+func sortFiles(files []file, key string, desc bool) {
+	var less func(i, j int) bool
+	switch key {
+	case "name":
+		less = func(i, j int) bool { return files[i].Name < files[j].Name }
+	case "size":
+		less = func(i, j int) bool { return files[i].Size < files[j].Size }
+	default:
+		less = func(i, j int) bool { return files[i].Mtime.Before(files[j].Mtime) }
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if desc {
+			i, j = j, i
+		}
+		return less(i, j)
+	})
+}
+
+// paginate returns the page of files selected by limit/offset. When the
+// page doesn't cover the full list, itemsLimitedTo is set to the total
+// number of files so the template can show a truncation notice.
+func paginate(files []file, limit, offset int) (page []file, itemsLimitedTo int) {
+	total := len(files)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+		itemsLimitedTo = total
+	}
+	return files[offset:end], itemsLimitedTo
+}
+
+// pageURL rewrites the request's query string with a new offset/limit,
+// for use in Prev/Next links.
+func pageURL(r *http.Request, offset, limit int) string {
+	u := *r.URL
+	q := u.Query()
+	q.Set("offset", strconv.Itoa(offset))
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func prevURL(r *http.Request, params listParams) string {
+	if params.offset <= 0 || params.limit <= 0 {
+		return ""
+	}
+	offset := params.offset - params.limit
+	if offset < 0 {
+		offset = 0
+	}
+	return pageURL(r, offset, params.limit)
+}
+
+func nextURL(r *http.Request, params listParams, total int) string {
+	if params.limit <= 0 || params.offset+params.limit >= total {
+		return ""
+	}
+	return pageURL(r, params.offset+params.limit, params.limit)
+}
+
+// dirEntryJSON is the shape used for ?format=json and ?format=csv
+// directory listings, covering both dirs and files.
+type dirEntryJSON struct {
+	Name  string    `json:"name"`
+	Path  string    `json:"path"`
+	Dir   bool      `json:"dir"`
+	Mtime time.Time `json:"mtime,omitempty"`
+	Size  int64     `json:"size,omitempty"`
+}
+
+func dirEntries(dirs []directory, files []file) []dirEntryJSON {
+	entries := make([]dirEntryJSON, 0, len(dirs)+len(files))
+	for _, d := range dirs {
+		entries = append(entries, dirEntryJSON{Name: d.Name, Path: d.Path, Dir: true})
+	}
+	for _, f := range files {
+		entries = append(entries, dirEntryJSON{Name: f.Name, Path: f.Path, Mtime: f.Mtime, Size: f.Size})
+	}
+	return entries
+}
+
+func writeDirJSON(w http.ResponseWriter, dirs []directory, files []file) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dirEntries(dirs, files)); err != nil {
+		log.Println("writeDirJSON:", err)
+	}
+}
+
+func writeDirCSV(w http.ResponseWriter, dirs []directory, files []file) {
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "path", "dir", "mtime", "size"})
+	for _, e := range dirEntries(dirs, files) {
+		mtime := ""
+		if !e.Mtime.IsZero() {
+			mtime = e.Mtime.Format(time.RFC3339)
+		}
+		size := ""
+		if e.Size > 0 {
+			size = strconv.FormatInt(e.Size, 10)
+		}
+		cw.Write([]string{e.Name, e.Path, strconv.FormatBool(e.Dir), mtime, size})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Println("writeDirCSV:", err)
+	}
+}
+
+// humanizeBytes formats n as a 1024-based human-readable size, e.g.
+// "12.3 KiB".
+func humanizeBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for nn := n / unit; nn >= unit; nn /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
 
 func breadcrumbs(r *http.Request) []directory {
 	xs := []directory{}
@@ -135,31 +340,23 @@ func internalServerError(w http.ResponseWriter, tag string, err error) {
 	http.Error(w, err.Error(), http.StatusInternalServerError)
 }
 
-func isDirectory(p string) (bool, error) {
-	info, err := os.Stat(p)
+func parseLog(fsys logFS, p string, opts ...ParserOption) (string, error) {
+	rc, err := fsys.Open(p)
 	if err != nil {
-		return false, err
+		return "", err
 	}
-	return info.IsDir(), nil
-}
-
-func logPath(p string) string {
-	dir := viper.GetString("enview.log.dir")
-	return filepath.Join(dir, p)
-}
-
-func parseLog(p string) (string, error) {
-	bs, err := ioutil.ReadFile(p)
+	defer rc.Close()
+	bs, err := ioutil.ReadAll(rc)
 	if err != nil {
 		return "", err
 	}
-	return parseHTML(bs)
+	return parseHTML(bs, opts...)
 }
 
-func readDir(dir string, p string) (dirs []directory, files []file, _ error) {
+func readDir(fsys logFS, dir string, p string) (dirs []directory, files []file, _ error) {
 	dirs = []directory{}
 	files = []file{}
-	entries, err := os.ReadDir(dir)
+	entries, err := fsys.ReadDir(dir)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -178,6 +375,7 @@ func readDir(dir string, p string) (dirs []directory, files []file, _ error) {
 				Path:  path.Join(p, e.Name()),
 				Name:  e.Name(),
 				Mtime: info.ModTime(),
+				Size:  info.Size(),
 			})
 		}
 	}
@@ -189,6 +387,7 @@ func renderView(w http.ResponseWriter, r *http.Request, name string, helpers tem
 		"formatTime": func(t time.Time) string {
 			return t.Format("2006-01-02 15:04:05")
 		},
+		"humanizeBytes": humanizeBytes,
 	}
 	for k, v := range helpers {
 		funcs[k] = v
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Palette holds the four color tables a parser consults when resolving
+// an SGR color code: the 8 standard colors (30-37/40-47), the 8 bright
+// colors (90-97/100-107), and the 256-color extension's grayscale ramp
+// and 6x6x6 color cube.
+type Palette struct {
+	Name      string
+	Low       []string
+	High      []string
+	Grayscale []string
+	Cube      []string
+}
+
+// color8bit resolves an `38;5;n` / `48;5;n` 256-color index against
+// this palette.
+func (p *Palette) color8bit(c int) string {
+	switch {
+	case 0 <= c && c <= 7:
+		return p.Low[c]
+	case 8 <= c && c <= 15:
+		return p.High[c-8]
+	case 16 <= c && c <= 231:
+		r := (c - 16) / 36
+		g := (c - 16 - 36*r) / 6
+		b := c - 16 - 36*r - 6*g
+		return "#" + p.Cube[r] + p.Cube[g] + p.Cube[b]
+	case 232 <= c && c <= 255:
+		return p.Grayscale[c-232]
+	default:
+		return ""
+	}
+}
+
+// palettes is the registry of named palettes available via the
+// enview.palette config key or a request's ?palette= query param.
+var palettes = map[string]*Palette{}
+
+func registerPalette(p *Palette) {
+	palettes[p.Name] = p
+}
+
+// LookupPalette returns the named palette, or false if no palette was
+// registered under that name.
+func LookupPalette(name string) (*Palette, bool) {
+	p, ok := palettes[name]
+	return p, ok
+}
+
+// DefaultPalette is used whenever a parser isn't given a WithPalette
+// option, and preserves the colors enview has always rendered.
+var DefaultPalette = &Palette{
+	Name:      "xterm",
+	Low:       LowColors,
+	High:      HighColors,
+	Grayscale: GrayscaleColors,
+	Cube:      CubeColors,
+}
+
+func init() {
+	registerPalette(DefaultPalette)
+	registerPalette(&Palette{
+		Name: "vga",
+		Low: []string{
+			"#000000", "#aa0000", "#00aa00", "#aa5500",
+			"#0000aa", "#aa00aa", "#00aaaa", "#aaaaaa",
+		},
+		High: []string{
+			"#555555", "#ff5555", "#55ff55", "#ffff55",
+			"#5555ff", "#ff55ff", "#55ffff", "#ffffff",
+		},
+		Grayscale: GrayscaleColors,
+		Cube:      CubeColors,
+	})
+	registerPalette(&Palette{
+		Name: "solarized-dark",
+		Low: []string{
+			"#073642", "#dc322f", "#859900", "#b58900",
+			"#268bd2", "#d33682", "#2aa198", "#eee8d5",
+		},
+		High: []string{
+			"#002b36", "#cb4b16", "#586e75", "#657b83",
+			"#839496", "#6c71c4", "#93a1a1", "#fdf6e3",
+		},
+		Grayscale: GrayscaleColors,
+		Cube:      CubeColors,
+	})
+	registerPalette(&Palette{
+		Name: "solarized-light",
+		Low: []string{
+			"#eee8d5", "#dc322f", "#859900", "#b58900",
+			"#268bd2", "#d33682", "#2aa198", "#073642",
+		},
+		High: []string{
+			"#fdf6e3", "#cb4b16", "#93a1a1", "#839496",
+			"#657b83", "#6c71c4", "#586e75", "#002b36",
+		},
+		Grayscale: GrayscaleColors,
+		Cube:      CubeColors,
+	})
+	registerPalette(&Palette{
+		Name: "monokai",
+		Low: []string{
+			"#272822", "#f92672", "#a6e22e", "#e6db74",
+			"#66d9ef", "#ae81ff", "#a1efe4", "#f8f8f2",
+		},
+		High: []string{
+			"#75715e", "#f92672", "#a6e22e", "#e6db74",
+			"#66d9ef", "#ae81ff", "#a1efe4", "#f9f8f5",
+		},
+		Grayscale: GrayscaleColors,
+		Cube:      CubeColors,
+	})
+	registerPalette(&Palette{
+		Name: "gruvbox",
+		Low: []string{
+			"#282828", "#cc241d", "#98971a", "#d79921",
+			"#458588", "#b16286", "#689d6a", "#a89984",
+		},
+		High: []string{
+			"#928374", "#fb4934", "#b8bb26", "#fabd2f",
+			"#83a598", "#d3869b", "#8ec07c", "#ebdbb2",
+		},
+		Grayscale: GrayscaleColors,
+		Cube:      CubeColors,
+	})
+}
+
+// PaletteCSS renders p's 16 standard colors as the ansi-fg-N/ansi-bg-N
+// classes emitted by a parser with the Classes(true) option, for
+// inclusion in a <style> block so the browser doesn't need an inline
+// style on every span.
+func PaletteCSS(p *Palette) string {
+	var b strings.Builder
+	for i, c := range p.Low {
+		fmt.Fprintf(&b, ".ansi-fg-%d { color: %s; }\n", i, c)
+		fmt.Fprintf(&b, ".ansi-bg-%d { background-color: %s; }\n", i, c)
+	}
+	for i, c := range p.High {
+		fmt.Fprintf(&b, ".ansi-fg-%d { color: %s; }\n", 8+i, c)
+		fmt.Fprintf(&b, ".ansi-bg-%d { background-color: %s; }\n", 8+i, c)
+	}
+	return b.String()
+}
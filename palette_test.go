@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupPalette(t *testing.T) {
+	for _, name := range []string{"xterm", "vga", "solarized-dark", "solarized-light", "monokai", "gruvbox"} {
+		p, ok := LookupPalette(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, name, p.Name)
+		assert.Len(t, p.Low, 8)
+		assert.Len(t, p.High, 8)
+	}
+
+	_, ok := LookupPalette("no-such-palette")
+	assert.False(t, ok)
+}
+
+func TestWithPaletteChangesResolvedColor(t *testing.T) {
+	vga, _ := LookupPalette("vga")
+	actual, err := parse("\x1b[31mfoo", WithPalette(vga))
+	assert.NoError(t, err)
+	assert.Equal(t, []text{{text: "foo", fg: "#aa0000"}}, actual)
+}
+
+func TestDefaultPalettePreservesExistingColors(t *testing.T) {
+	actual, err := parse("\x1b[31mfoo")
+	assert.NoError(t, err)
+	assert.Equal(t, []text{{text: "foo", fg: "#800000"}}, actual)
+}
+
+func TestClassesRendersAnsiClassesForStandardColors(t *testing.T) {
+	html, err := parseHTML([]byte("\x1b[31;44mfoo"), Classes(true))
+	assert.NoError(t, err)
+	assert.Contains(t, html, "ansi-fg-1")
+	assert.Contains(t, html, "ansi-bg-4")
+	assert.NotContains(t, html, "color:")
+}
+
+func TestClassesFallsBackToInlineStyleForTruecolor(t *testing.T) {
+	html, err := parseHTML([]byte("\x1b[38;2;1;2;3mfoo"), Classes(true))
+	assert.NoError(t, err)
+	assert.Contains(t, html, "color: #010203")
+}
+
+func TestPaletteCSSCoversAllSixteenColors(t *testing.T) {
+	css := PaletteCSS(DefaultPalette)
+	for i := 0; i < 16; i++ {
+		assert.Contains(t, css, fmt.Sprintf("ansi-fg-%d", i))
+		assert.Contains(t, css, fmt.Sprintf("ansi-bg-%d", i))
+	}
+}
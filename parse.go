@@ -10,8 +10,42 @@ import (
 
 var parseError = errors.New("parse error")
 
-func parseHTML(bs []byte) (string, error) {
+// ParserOption configures a parser before it processes any input.
+type ParserOption func(*parser)
+
+// Strict makes the parser return parseError for any SGR code it doesn't
+// recognize, instead of silently ignoring it. Useful for detecting
+// corrupted logs.
+func Strict(strict bool) ParserOption {
+	return func(p *parser) {
+		p.strict = strict
+	}
+}
+
+// WithPalette selects the color table used to resolve SGR color codes.
+// Defaults to DefaultPalette when not given.
+func WithPalette(palette *Palette) ParserOption {
+	return func(p *parser) {
+		p.palette = palette
+	}
+}
+
+// Classes makes toHTML emit `class="ansi-fg-N ansi-bg-N"` for the 16
+// standard colors instead of inline styles, so a page can define those
+// classes once (see PaletteCSS) instead of repeating the color on every
+// span. Colors outside the 16-color range (256-color, truecolor) still
+// render as inline styles.
+func Classes(useClasses bool) ParserOption {
+	return func(p *parser) {
+		p.useClasses = useClasses
+	}
+}
+
+func parseHTML(bs []byte, opts ...ParserOption) (string, error) {
 	var p parser
+	for _, opt := range opts {
+		opt(&p)
+	}
 	if err := p.parse(string(bs)); err != nil {
 		return "", err
 	}
@@ -22,38 +56,116 @@ func parseHTML(bs []byte) (string, error) {
 	return strings.Join(chunks, ""), nil
 }
 
+// parsePlainText strips ANSI escape sequences from bs and returns the
+// underlying text, for consumers (like search indexing) that need to
+// work with the content but don't care about styling.
+func parsePlainText(bs []byte) string {
+	var p parser
+	if err := p.parse(string(bs)); err != nil {
+		return string(bs)
+	}
+	chunks := make([]string, len(p.ts))
+	for i, t := range p.ts {
+		chunks[i] = t.text
+	}
+	return strings.Join(chunks, "")
+}
+
 type text struct {
 	text string
 	bg   string
 	fg   string
 	bold bool
+
+	italic    bool
+	underline bool
+	blink     bool
+	inverse   bool
+	conceal   bool
+	strike    bool
+
+	// fgIdx/bgIdx hold one more than the 0-15 standard-color index
+	// backing fg/bg (so the zero value means "not a standard color" --
+	// e.g. it came from the 256-color cube, grayscale ramp, or 24-bit
+	// truecolor -- and has no ansi-fg-N class to render).
+	fgIdx      int
+	bgIdx      int
+	useClasses bool
 }
 
 func (t *text) toHTML() string {
-	escaped := html.EscapeString(t.text)
-	var styles []string
-	if len(t.bg) > 0 {
-		styles = append(styles, "background-color: "+t.bg)
+	return t.render(html.EscapeString(t.text))
+}
+
+// render wraps content -- t.text, already escaped, with any markup a
+// caller (e.g. search highlighting) has added -- in the <span> (or lack
+// thereof) that t's styling calls for. Kept separate from toHTML so
+// that markup, never the escaping itself, lives outside the tag's
+// attributes.
+func (t *text) render(content string) string {
+	escaped := content
+	fg, bg := t.fg, t.bg
+	fgIdx, bgIdx := t.fgIdx, t.bgIdx
+	if t.inverse {
+		fg, bg = bg, fg
+		fgIdx, bgIdx = bgIdx, fgIdx
+	}
+
+	var classes, styles []string
+	if t.useClasses && bgIdx > 0 {
+		classes = append(classes, fmt.Sprintf("ansi-bg-%d", bgIdx-1))
+	} else if len(bg) > 0 {
+		styles = append(styles, "background-color: "+bg)
 	}
-	if len(t.fg) > 0 {
-		styles = append(styles, "color: "+t.fg)
+	if t.useClasses && fgIdx > 0 {
+		classes = append(classes, fmt.Sprintf("ansi-fg-%d", fgIdx-1))
+	} else if len(fg) > 0 {
+		styles = append(styles, "color: "+fg)
 	}
 	if t.bold {
 		styles = append(styles, "font-weight: bold")
 	}
+	if t.italic {
+		styles = append(styles, "font-style: italic")
+	}
+	if t.conceal {
+		styles = append(styles, "visibility: hidden")
+	}
+	var decorations []string
+	if t.underline {
+		decorations = append(decorations, "underline")
+	}
+	if t.strike {
+		decorations = append(decorations, "line-through")
+	}
+	if t.blink {
+		decorations = append(decorations, "blink")
+	}
+	if len(decorations) > 0 {
+		styles = append(styles, "text-decoration: "+strings.Join(decorations, " "))
+	}
+
+	var attrs []string
+	if len(classes) > 0 {
+		attrs = append(attrs, fmt.Sprintf("class=\"%s\"", strings.Join(classes, " ")))
+	}
 	if len(styles) > 0 {
-		style := strings.Join(styles, "; ")
-		return fmt.Sprintf("<span style=\"%v\">%v</span>", style, escaped)
-	} else {
-		return escaped
+		attrs = append(attrs, fmt.Sprintf("style=\"%s\"", strings.Join(styles, "; ")))
 	}
+	if len(attrs) > 0 {
+		return fmt.Sprintf("<span %v>%v</span>", strings.Join(attrs, " "), escaped)
+	}
+	return escaped
 }
 
-func parse(in string) ([]text, error) {
+func parse(in string, opts ...ParserOption) ([]text, error) {
 	if len(in) == 0 {
 		return []text{}, nil
 	}
 	p := &parser{}
+	for _, opt := range opts {
+		opt(p)
+	}
 	err := p.parse(in)
 	return p.ts, err
 }
@@ -61,29 +173,67 @@ func parse(in string) ([]text, error) {
 type parseState func(c rune) (parseState, error)
 
 type parser struct {
-	state parseState
-	ts    []text
-	b     strings.Builder
-	c     strings.Builder
+	state      parseState
+	ts         []text
+	b          strings.Builder
+	c          strings.Builder
+	strict     bool
+	palette    *Palette
+	useClasses bool
 
 	bg   string
 	fg   string
 	bold bool
+
+	italic    bool
+	underline bool
+	blink     bool
+	inverse   bool
+	conceal   bool
+	strike    bool
+
+	// fgIdx/bgIdx track the 0-15 standard-color index backing fg/bg,
+	// offset by one so the zero value means "not a standard color".
+	// Only maintained when useClasses is set, so parsers created
+	// without it behave exactly as before.
+	fgIdx int
+	bgIdx int
 }
 
 func (p *parser) append() {
 	p.ts = append(p.ts, text{
-		text: p.b.String(),
-		bg:   p.bg,
-		fg:   p.fg,
-		bold: p.bold,
+		text:      p.b.String(),
+		bg:        p.bg,
+		fg:        p.fg,
+		bold:      p.bold,
+		italic:    p.italic,
+		underline: p.underline,
+		blink:     p.blink,
+		inverse:   p.inverse,
+		conceal:   p.conceal,
+		strike:    p.strike,
+
+		fgIdx:      p.fgIdx,
+		bgIdx:      p.bgIdx,
+		useClasses: p.useClasses,
 	})
 	p.b.Reset()
 }
 
+// parse processes in and appends the resulting text chunks to p.ts,
+// picking up wherever the SGR state (and, if in's last escape sequence
+// was split across calls, the state machine itself) left off. Calling
+// it more than once on the same parser lets a caller like TailPath feed
+// it a log file in pieces without losing open color/style spans at the
+// chunk boundary; use Reset between unrelated streams.
 func (p *parser) parse(in string) (err error) {
 	p.ts = []text{}
-	p.state = p.parsePlain
+	if p.state == nil {
+		p.state = p.parsePlain
+	}
+	if p.palette == nil {
+		p.palette = DefaultPalette
+	}
 	for _, c := range in {
 		p.state, err = p.state(c)
 		if err != nil {
@@ -94,6 +244,18 @@ func (p *parser) parse(in string) (err error) {
 	return
 }
 
+// Reset clears p's accumulated SGR and parse state so it can be reused
+// for a new, unrelated input stream -- e.g. TailPath starting over
+// after the file it's following gets rotated out from under it. The
+// strict/palette/useClasses options p was configured with are kept.
+func (p *parser) Reset() {
+	*p = parser{
+		strict:     p.strict,
+		palette:    p.palette,
+		useClasses: p.useClasses,
+	}
+}
+
 func (p *parser) parseCSI(c rune) (parseState, error) {
 	if c == 'm' {
 		strs := strings.Split(p.c.String(), ";")
@@ -112,36 +274,94 @@ func (p *parser) parseCSI(c rune) (parseState, error) {
 				p.bg = ""
 				p.fg = ""
 				p.bold = false
+				p.italic = false
+				p.underline = false
+				p.blink = false
+				p.inverse = false
+				p.conceal = false
+				p.strike = false
+				if p.useClasses {
+					p.fgIdx = 0
+					p.bgIdx = 0
+				}
 			case 1 == c:
 				p.bold = true
+			case 3 == c:
+				p.italic = true
+			case 4 == c:
+				p.underline = true
+			case 5 == c:
+				p.blink = true
+			case 7 == c:
+				p.inverse = true
+			case 8 == c:
+				p.conceal = true
+			case 9 == c:
+				p.strike = true
+			case 22 == c:
+				p.bold = false
+			case 23 == c:
+				p.italic = false
+			case 24 == c:
+				p.underline = false
+			case 27 == c:
+				p.inverse = false
+			case 28 == c:
+				p.conceal = false
+			case 29 == c:
+				p.strike = false
 			case 30 <= c && c <= 37:
-				p.fg = LowColors[c-30]
+				p.fg = p.palette.Low[c-30]
+				if p.useClasses {
+					p.fgIdx = c - 30 + 1
+				}
 			case 38 == c:
-				if i < len(codes)-2 {
-					i++
-					if 5 == codes[i] {
-						i++
-						p.fg = color8bit(codes[i])
-					}
-				} else {
-					return nil, parseError
+				var err error
+				i, p.fg, err = parseExtendedColor(codes, i, p.palette)
+				if err != nil {
+					return nil, err
+				}
+				if p.useClasses {
+					p.fgIdx = 0
+				}
+			case 39 == c:
+				p.fg = ""
+				if p.useClasses {
+					p.fgIdx = 0
 				}
 			case 40 <= c && c <= 47:
-				p.bg = LowColors[c-40]
+				p.bg = p.palette.Low[c-40]
+				if p.useClasses {
+					p.bgIdx = c - 40 + 1
+				}
 			case 48 == c:
-				if i < len(codes)-2 {
-					i++
-					if 5 == codes[i] {
-						i++
-						p.bg = color8bit(codes[i])
-					}
-				} else {
-					return nil, parseError
+				var err error
+				i, p.bg, err = parseExtendedColor(codes, i, p.palette)
+				if err != nil {
+					return nil, err
+				}
+				if p.useClasses {
+					p.bgIdx = 0
+				}
+			case 49 == c:
+				p.bg = ""
+				if p.useClasses {
+					p.bgIdx = 0
 				}
 			case 90 <= c && c <= 97:
-				p.fg = HighColors[c-90]
+				p.fg = p.palette.High[c-90]
+				if p.useClasses {
+					p.fgIdx = 8 + c - 90 + 1
+				}
 			case 100 <= c && c <= 107:
-				p.bg = HighColors[c-100]
+				p.bg = p.palette.High[c-100]
+				if p.useClasses {
+					p.bgIdx = 8 + c - 100 + 1
+				}
+			default:
+				if p.strict {
+					return nil, parseError
+				}
 			}
 		}
 		return p.parsePlain, nil
@@ -198,22 +418,33 @@ var GrayscaleColors = []string{
 	"#bcbcbc", "#c6c6c6", "#d0d0d0", "#dadada", "#e4e4e4", "#eeeeee",
 }
 
-var CubeColors = []string{"00", "5f", "87", "af", "d7", "ff"}
-
-func color8bit(c int) string {
-	switch {
-	case 0 <= c && c <= 7:
-		return LowColors[c]
-	case 8 <= c && c <= 15:
-		return HighColors[c-8]
-	case 16 <= c && c <= 231:
-		r := (c - 16) / 36
-		g := (c - 16 - 36*r) / 6
-		b := c - 16 - 36*r - 6*g
-		return "#" + CubeColors[r] + CubeColors[g] + CubeColors[b]
-	case 232 <= c && c <= 255:
-		return GrayscaleColors[c-232]
+// parseExtendedColor parses the `5;n` (8-bit) or `2;r;g;b` (24-bit
+// truecolor) parameter sequence that follows a 38 or 48 SGR code,
+// starting at codes[i+1]. It returns the index of the last parameter it
+// consumed and the resolved CSS color, or parseError if the parameter
+// list is too short or the subcode is unrecognized.
+func parseExtendedColor(codes []int, i int, palette *Palette) (int, string, error) {
+	if i >= len(codes)-1 {
+		return i, "", parseError
+	}
+	i++
+	switch codes[i] {
+	case 5:
+		if i >= len(codes)-1 {
+			return i, "", parseError
+		}
+		i++
+		return i, palette.color8bit(codes[i]), nil
+	case 2:
+		if i+3 > len(codes)-1 {
+			return i, "", parseError
+		}
+		r, g, b := codes[i+1], codes[i+2], codes[i+3]
+		i += 3
+		return i, fmt.Sprintf("#%02x%02x%02x", r, g, b), nil
 	default:
-		return ""
+		return i, "", parseError
 	}
 }
+
+var CubeColors = []string{"00", "5f", "87", "af", "d7", "ff"}
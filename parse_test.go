@@ -53,6 +53,31 @@ func TestParse(t *testing.T) {
 		// multiple sequences
 		{"\x1b[1m\x1b[33mfoo", []text{
 			{text: "foo", bold: true, fg: "#808000"}}},
+
+		// italic, underline, blink, inverse, conceal, strikethrough
+		{"\x1b[3mfoo", []text{{text: "foo", italic: true}}},
+		{"\x1b[4mfoo", []text{{text: "foo", underline: true}}},
+		{"\x1b[5mfoo", []text{{text: "foo", blink: true}}},
+		{"\x1b[7mfoo", []text{{text: "foo", inverse: true}}},
+		{"\x1b[8mfoo", []text{{text: "foo", conceal: true}}},
+		{"\x1b[9mfoo", []text{{text: "foo", strike: true}}},
+
+		// individual resets
+		{"\x1b[1;22mfoo", []text{{text: "foo"}}},
+		{"\x1b[3;23mfoo", []text{{text: "foo"}}},
+		{"\x1b[4;24mfoo", []text{{text: "foo"}}},
+		{"\x1b[7;27mfoo", []text{{text: "foo"}}},
+		{"\x1b[8;28mfoo", []text{{text: "foo"}}},
+		{"\x1b[9;29mfoo", []text{{text: "foo"}}},
+
+		// default fg/bg resets
+		{"\x1b[31;41mfoo\x1b[39;49mbar", []text{
+			{text: "foo", fg: "#800000", bg: "#800000"},
+			{text: "bar"}}},
+
+		// 24-bit truecolor
+		{"\x1b[38;2;18;52;86;48;2;255;0;128mword", []text{
+			{text: "word", fg: "#123456", bg: "#ff0080"}}},
 	}
 	for _, test := range tests {
 		actual, err := parse(test.input)
@@ -60,3 +85,25 @@ func TestParse(t *testing.T) {
 		assert.Equal(t, test.expected, actual)
 	}
 }
+
+func TestParseMalformedTruecolor(t *testing.T) {
+	tests := []string{
+		"\x1b[38;2;255mfoo",   // missing g, b
+		"\x1b[38;2;255;0mfoo", // missing b
+		"\x1b[48;2;255mfoo",   // missing g, b
+		"\x1b[38;2mfoo",       // missing r, g, b
+	}
+	for _, input := range tests {
+		_, err := parse(input)
+		assert.Equal(t, parseError, err)
+	}
+}
+
+func TestParseStrictMode(t *testing.T) {
+	_, err := parse("\x1b[59mfoo", Strict(true))
+	assert.Equal(t, parseError, err)
+
+	actual, err := parse("\x1b[59mfoo", Strict(false))
+	assert.NoError(t, err)
+	assert.Equal(t, []text{{text: "foo"}}, actual)
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	viper.SetDefault("enview.search.max_results", 100)
+	viper.SetDefault("enview.search.snippet_lines", 1)
+	viper.SetDefault("enview.search.case_sensitive", false)
+}
+
+// searchIdx is the process-wide index built at startup by
+// initSearchIndex and kept up to date by its watcher goroutine.
+var searchIdx *searchIndex
+
+// initSearchIndex walks enview.log.dir, builds the in-memory search
+// index, and starts a background goroutine that reindexes files as they
+// change. It always leaves searchIdx set, even if the initial walk
+// fails, so SearchPath can degrade to "no results" instead of panicking.
+func initSearchIndex() error {
+	dir := viper.GetString("enview.log.dir")
+	caseSensitive := viper.GetBool("enview.search.case_sensitive")
+	idx, err := newSearchIndex(dir, caseSensitive)
+	if err != nil {
+		idx = emptySearchIndex(dir, caseSensitive)
+		searchIdx = idx
+		return err
+	}
+	searchIdx = idx
+	return idx.watch()
+}
+
+// posting records one occurrence of a token.
+type posting struct {
+	File   string
+	Line   int
+	Offset int64
+}
+
+// searchIndex is an in-memory inverted index (token -> postings) over
+// the plain-text content of every file under dir, with the raw lines
+// kept alongside so matches can be re-rendered through parseHTML with
+// their ANSI styling intact.
+type searchIndex struct {
+	mu            sync.RWMutex
+	dir           string
+	caseSensitive bool
+	tokens        map[string][]posting
+	plainLines    map[string][]string
+	rawLines      map[string][]string
+}
+
+func emptySearchIndex(dir string, caseSensitive bool) *searchIndex {
+	return &searchIndex{
+		dir:           dir,
+		caseSensitive: caseSensitive,
+		tokens:        map[string][]posting{},
+		plainLines:    map[string][]string{},
+		rawLines:      map[string][]string{},
+	}
+}
+
+func newSearchIndex(dir string, caseSensitive bool) (*searchIndex, error) {
+	idx := emptySearchIndex(dir, caseSensitive)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		return idx.indexFile(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+func (idx *searchIndex) relPath(p string) string {
+	rel, err := filepath.Rel(idx.dir, p)
+	if err != nil {
+		return p
+	}
+	return rel
+}
+
+// indexFile (re)indexes a single file, replacing any postings left over
+// from a previous version of it.
+func (idx *searchIndex) indexFile(p string) error {
+	bs, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	rel := idx.relPath(p)
+	raw := strings.Split(string(bs), "\n")
+	plain := strings.Split(parsePlainText(bs), "\n")
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeFileLocked(rel)
+	idx.rawLines[rel] = raw
+	idx.plainLines[rel] = plain
+
+	var offset int64
+	for lineNo, line := range plain {
+		for _, tok := range idx.tokenize(line) {
+			idx.tokens[tok] = append(idx.tokens[tok], posting{File: rel, Line: lineNo, Offset: offset})
+		}
+		// Advance by the raw (ANSI-including) line's length, not the
+		// tokenized plain-text line's, so Offset lands on the matching
+		// byte in the actual file rather than in the stripped text.
+		offset += int64(len(raw[lineNo])) + 1
+	}
+	return nil
+}
+
+func (idx *searchIndex) removeFile(rel string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeFileLocked(rel)
+}
+
+func (idx *searchIndex) removeFileLocked(rel string) {
+	delete(idx.rawLines, rel)
+	delete(idx.plainLines, rel)
+	for tok, postings := range idx.tokens {
+		kept := postings[:0]
+		for _, p := range postings {
+			if p.File != rel {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.tokens, tok)
+		} else {
+			idx.tokens[tok] = kept
+		}
+	}
+}
+
+func (idx *searchIndex) tokenize(s string) []string {
+	if !idx.caseSensitive {
+		s = strings.ToLower(s)
+	}
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// watch starts a goroutine that reindexes files under idx.dir as
+// fsnotify reports them changing. The caller owns the returned error
+// only for the initial watch setup; failures after that are logged.
+func (idx *searchIndex) watch() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := idx.watchRecursive(w); err != nil {
+		w.Close()
+		return err
+	}
+	go func() {
+		defer w.Close()
+		for {
+			select {
+			case event, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				idx.handleEvent(event)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Println("search: watch:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (idx *searchIndex) watchRecursive(w *fsnotify.Watcher) error {
+	return filepath.Walk(idx.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return w.Add(p)
+		}
+		return nil
+	})
+}
+
+func (idx *searchIndex) handleEvent(event fsnotify.Event) {
+	switch {
+	case event.Op&(fsnotify.Write|fsnotify.Create) != 0:
+		info, err := os.Stat(event.Name)
+		if err != nil || info.IsDir() {
+			return
+		}
+		if err := idx.indexFile(event.Name); err != nil {
+			log.Println("search: reindex:", err)
+		}
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		idx.removeFile(idx.relPath(event.Name))
+	}
+}
+
+// SearchResult is one matching line, rendered through parseHTML with
+// its match wrapped in <mark>.
+type SearchResult struct {
+	File string
+	Line int
+	HTML string
+}
+
+// clause is one term or phrase in a parsed query, joined to the
+// previous clause by Op ("AND" or "OR"), optionally negated by a
+// leading NOT.
+type clause struct {
+	op     string
+	tokens []string
+	negate bool
+}
+
+func (idx *searchIndex) parseQuery(q string) []clause {
+	fields := splitQueryFields(q)
+	var clauses []clause
+	op := "AND"
+	negate := false
+	for _, f := range fields {
+		switch strings.ToUpper(f) {
+		case "AND":
+			op = "AND"
+		case "OR":
+			op = "OR"
+		case "NOT":
+			negate = true
+		default:
+			clauses = append(clauses, clause{op: op, tokens: idx.tokenize(f), negate: negate})
+			op = "AND"
+			negate = false
+		}
+	}
+	return clauses
+}
+
+// splitQueryFields splits a query on whitespace, keeping "quoted
+// phrases" together as a single field.
+func splitQueryFields(q string) []string {
+	var fields []string
+	var cur strings.Builder
+	inQuotes := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ' ' && !inQuotes:
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+// matchClause returns, for every file matching the clause, the line
+// number of its first match.
+func (idx *searchIndex) matchClause(c clause) map[string]int {
+	matches := map[string]int{}
+	if len(c.tokens) == 0 {
+		return matches
+	}
+	if len(c.tokens) == 1 {
+		for _, p := range idx.tokens[c.tokens[0]] {
+			if _, ok := matches[p.File]; !ok {
+				matches[p.File] = p.Line
+			}
+		}
+		return matches
+	}
+	phrase := strings.Join(c.tokens, " ")
+	for file, lines := range idx.plainLines {
+		for i, line := range lines {
+			if !idx.caseSensitive {
+				line = strings.ToLower(line)
+			}
+			if strings.Contains(line, phrase) {
+				matches[file] = i
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func combineMatches(op string, a, b map[string]int) map[string]int {
+	result := map[string]int{}
+	if op == "OR" {
+		for f, line := range a {
+			result[f] = line
+		}
+		for f, line := range b {
+			if _, ok := result[f]; !ok {
+				result[f] = line
+			}
+		}
+		return result
+	}
+	for f, line := range a {
+		if _, ok := b[f]; ok {
+			result[f] = line
+		}
+	}
+	return result
+}
+
+// Search evaluates query against the index and returns up to
+// maxResults matches, each rendered through parseHTML with the match
+// highlighted and snippetLines of surrounding context on either side.
+func (idx *searchIndex) Search(query string, maxResults, snippetLines int) []SearchResult {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	clauses := idx.parseQuery(query)
+	var matched map[string]int
+	for _, c := range clauses {
+		m := idx.matchClause(c)
+		if c.negate {
+			for f := range m {
+				delete(matched, f)
+			}
+			continue
+		}
+		if matched == nil {
+			matched = m
+		} else {
+			matched = combineMatches(c.op, matched, m)
+		}
+	}
+
+	files := make([]string, 0, len(matched))
+	for f := range matched {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	term := ""
+	for _, c := range clauses {
+		if !c.negate && len(c.tokens) > 0 {
+			term = strings.Join(c.tokens, " ")
+			break
+		}
+	}
+
+	results := make([]SearchResult, 0, len(files))
+	for _, f := range files {
+		if maxResults > 0 && len(results) >= maxResults {
+			break
+		}
+		line := matched[f]
+		results = append(results, SearchResult{
+			File: f,
+			Line: line,
+			HTML: idx.renderSnippet(f, line, snippetLines, term),
+		})
+	}
+	return results
+}
+
+func (idx *searchIndex) renderSnippet(file string, line, snippetLines int, term string) string {
+	raw := idx.rawLines[file]
+	lo, hi := line-snippetLines, line+snippetLines
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > len(raw)-1 {
+		hi = len(raw) - 1
+	}
+	var re *regexp.Regexp
+	if term != "" {
+		re = regexp.MustCompile(`(?i)` + regexp.QuoteMeta(term))
+	}
+	rendered := make([]string, 0, hi-lo+1)
+	for i := lo; i <= hi; i++ {
+		rendered = append(rendered, highlightLine(raw[i], re))
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// highlightLine parses raw -- preserving its ANSI styling -- and
+// renders it to HTML with each match of re wrapped in <mark>.
+// Highlighting is applied to each styled segment's text content before
+// it's handed to text.render, so a term that also happens to match
+// part of the surrounding markup (e.g. "bold", a CSS property name)
+// can never land inside a tag or attribute. re is nil when there's no
+// term to highlight.
+func highlightLine(raw string, re *regexp.Regexp) string {
+	ts, err := parse(raw)
+	if err != nil {
+		return html.EscapeString(raw)
+	}
+	var b strings.Builder
+	for _, t := range ts {
+		b.WriteString(t.render(highlightText(t.text, re)))
+	}
+	return b.String()
+}
+
+// highlightText HTML-escapes s, wrapping each match of re in <mark>.
+func highlightText(s string, re *regexp.Regexp) string {
+	if re == nil {
+		return html.EscapeString(s)
+	}
+	locs := re.FindAllStringIndex(s, -1)
+	if locs == nil {
+		return html.EscapeString(s)
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range locs {
+		b.WriteString(html.EscapeString(s[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(s[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(html.EscapeString(s[last:]))
+	return b.String()
+}
+
+func SearchPath(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	var results []SearchResult
+	if q != "" && searchIdx != nil {
+		maxResults := viper.GetInt("enview.search.max_results")
+		snippetLines := viper.GetInt("enview.search.snippet_lines")
+		results = searchIdx.Search(q, maxResults, snippetLines)
+	}
+	renderView(w, r, "search", nil, map[string]interface{}{
+		"Query":   q,
+		"Results": results,
+	})
+}
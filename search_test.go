@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFixture(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("writeFixture: %v", err)
+	}
+}
+
+func newFixtureIndex(t *testing.T) *searchIndex {
+	t.Helper()
+	dir := t.TempDir()
+	writeFixture(t, dir, "one.log", "\x1b[31merror\x1b[0m: disk full\nall quiet here")
+	writeFixture(t, dir, "two.log", "everything is fine\nanother error occurred")
+	idx, err := newSearchIndex(dir, false)
+	if err != nil {
+		t.Fatalf("newSearchIndex: %v", err)
+	}
+	return idx
+}
+
+func TestSearchSingleTerm(t *testing.T) {
+	idx := newFixtureIndex(t)
+	results := idx.Search("error", 10, 0)
+	assert.Len(t, results, 2)
+}
+
+func TestSearchIsCaseInsensitiveByDefault(t *testing.T) {
+	idx := newFixtureIndex(t)
+	results := idx.Search("ERROR", 10, 0)
+	assert.Len(t, results, 2)
+}
+
+func TestSearchPhrase(t *testing.T) {
+	idx := newFixtureIndex(t)
+	results := idx.Search(`"disk full"`, 10, 0)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "one.log", results[0].File)
+}
+
+func TestSearchBooleanAndOr(t *testing.T) {
+	idx := newFixtureIndex(t)
+
+	results := idx.Search("error AND occurred", 10, 0)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "two.log", results[0].File)
+
+	results = idx.Search("fine OR full", 10, 0)
+	assert.Len(t, results, 2)
+}
+
+func TestSearchBooleanNot(t *testing.T) {
+	idx := newFixtureIndex(t)
+	results := idx.Search("error NOT occurred", 10, 0)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "one.log", results[0].File)
+}
+
+func TestSearchHighlightsMatchPreservingANSI(t *testing.T) {
+	idx := newFixtureIndex(t)
+	results := idx.Search("error", 10, 0)
+	for _, r := range results {
+		if r.File == "one.log" {
+			assert.Contains(t, r.HTML, "<mark>")
+			assert.Contains(t, r.HTML, "color: #800000")
+		}
+	}
+}
+
+func TestSearchHighlightDoesNotCorruptMarkup(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, dir, "bold.log", "\x1b[1mbold text here\x1b[0m")
+	idx, err := newSearchIndex(dir, false)
+	if err != nil {
+		t.Fatalf("newSearchIndex: %v", err)
+	}
+	results := idx.Search("bold", 10, 0)
+	if assert.Len(t, results, 1) {
+		html := results[0].HTML
+		assert.Contains(t, html, `style="font-weight: bold"`)
+		assert.Contains(t, html, "<mark>bold</mark>")
+	}
+}
+
+func TestIndexFileOffsetPointsAtRawLineStart(t *testing.T) {
+	dir := t.TempDir()
+	content := "\x1b[31merror\x1b[0m: disk full\nsecond line error"
+	writeFixture(t, dir, "off.log", content)
+	idx, err := newSearchIndex(dir, false)
+	if err != nil {
+		t.Fatalf("newSearchIndex: %v", err)
+	}
+	postings := idx.tokens["error"]
+	if assert.Len(t, postings, 2) {
+		lines := strings.Split(content, "\n")
+		assert.Equal(t, int64(0), postings[0].Offset)
+		assert.Equal(t, int64(len(lines[0])+1), postings[1].Offset)
+	}
+}
+
+func TestSearchMaxResults(t *testing.T) {
+	idx := newFixtureIndex(t)
+	results := idx.Search("error", 1, 0)
+	assert.Len(t, results, 1)
+}
+
+func TestSearchNoMatches(t *testing.T) {
+	idx := newFixtureIndex(t)
+	results := idx.Search("nonexistent", 10, 0)
+	assert.Len(t, results, 0)
+}
+
+func TestSearchIndexIncrementalReindex(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, dir, "live.log", "nothing interesting")
+	idx, err := newSearchIndex(dir, false)
+	if err != nil {
+		t.Fatalf("newSearchIndex: %v", err)
+	}
+	assert.Len(t, idx.Search("banana", 10, 0), 0)
+
+	writeFixture(t, dir, "live.log", "banana split")
+	if err := idx.indexFile(filepath.Join(dir, "live.log")); err != nil {
+		t.Fatalf("indexFile: %v", err)
+	}
+	assert.Len(t, idx.Search("banana", 10, 0), 1)
+}
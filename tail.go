@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	viper.SetDefault("enview.tail.poll_interval", "1s")
+}
+
+// TailPath streams a log file as Server-Sent Events: it sends the
+// file's current contents as one "chunk" event, then polls Stat for
+// appended data and pushes each new chunk as it arrives. It reuses a
+// single parser for the whole connection so SGR state (an open color
+// or style span) carries across chunk boundaries. If the file shrinks
+// between polls -- the usual sign it was rotated out from under us --
+// it sends a "reset" event and starts over from the top with a fresh
+// parser.
+func TailPath(w http.ResponseWriter, r *http.Request) {
+	fsys, p, err := resolve(r.URL.Path)
+	if err != nil {
+		internalServerError(w, "resolve", err)
+		return
+	}
+	info, err := fsys.Stat(p)
+	if err != nil {
+		internalServerError(w, "stat", err)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, "cannot tail a directory", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	pr := &parser{palette: selectedPalette(r), useClasses: r.URL.Query().Get("classes") == "1"}
+	size, err := tailSend(w, fsys, p, pr, 0)
+	if err != nil {
+		internalServerError(w, "parseLog", err)
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(viper.GetDuration("enview.tail.poll_interval"))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			latest, err := fsys.Stat(p)
+			if err != nil {
+				writeSSEEvent(w, "error", err.Error())
+				flusher.Flush()
+				return
+			}
+			switch {
+			case latest.Size() < size:
+				writeSSEEvent(w, "reset", "")
+				pr.Reset()
+				size = 0
+				fallthrough
+			case latest.Size() > size:
+				size, err = tailSend(w, fsys, p, pr, size)
+				if err != nil {
+					writeSSEEvent(w, "error", err.Error())
+					flusher.Flush()
+					return
+				}
+			default:
+				continue
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// tailSend reads p from fsys, runs the portion of it past offset
+// through pr, and writes the resulting HTML as a "chunk" event. It
+// returns the file's new total size.
+func tailSend(w http.ResponseWriter, fsys logFS, p string, pr *parser, offset int64) (int64, error) {
+	rc, err := fsys.Open(p)
+	if err != nil {
+		return offset, err
+	}
+	defer rc.Close()
+	bs, err := io.ReadAll(rc)
+	if err != nil {
+		return offset, err
+	}
+	if int64(len(bs)) <= offset {
+		return offset, nil
+	}
+	if err := pr.parse(string(bs[offset:])); err != nil {
+		return offset, err
+	}
+	var html strings.Builder
+	for _, t := range pr.ts {
+		html.WriteString(t.toHTML())
+	}
+	writeSSEEvent(w, "chunk", html.String())
+	return int64(len(bs)), nil
+}
+
+// writeSSEEvent writes data as an SSE event of the given name, one
+// "data:" line per line of data since a literal newline can't appear
+// inside a single SSE data field.
+func writeSSEEvent(w http.ResponseWriter, event, data string) {
+	fmt.Fprintf(w, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
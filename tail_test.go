@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTailSendOnlySendsNewBytes(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, dir, "foo.log", "hello ")
+
+	fsys := diskFS{base: dir}
+	pr := &parser{}
+
+	w := httptest.NewRecorder()
+	size, err := tailSend(w, fsys, "foo.log", pr, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("hello ")), size)
+	assert.Contains(t, w.Body.String(), "event: chunk")
+	assert.Contains(t, w.Body.String(), "data: hello ")
+
+	writeFixture(t, dir, "foo.log", "hello world")
+	w2 := httptest.NewRecorder()
+	size, err = tailSend(w2, fsys, "foo.log", pr, size)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("hello world")), size)
+	assert.Contains(t, w2.Body.String(), "data: world")
+	assert.NotContains(t, w2.Body.String(), "data: hello world")
+}
+
+func TestTailSendCarriesSGRStateAcrossChunks(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, dir, "foo.log", "\x1b[31mred")
+
+	fsys := diskFS{base: dir}
+	pr := &parser{}
+
+	w := httptest.NewRecorder()
+	size, err := tailSend(w, fsys, "foo.log", pr, 0)
+	assert.NoError(t, err)
+
+	writeFixture(t, dir, "foo.log", "\x1b[31mred still red")
+	w2 := httptest.NewRecorder()
+	_, err = tailSend(w2, fsys, "foo.log", pr, size)
+	assert.NoError(t, err)
+	assert.Contains(t, w2.Body.String(), "color: #800000")
+}
+
+func TestParserResetClearsStyleButKeepsOptions(t *testing.T) {
+	vga, _ := LookupPalette("vga")
+	pr := &parser{palette: vga, useClasses: true}
+	assert.NoError(t, pr.parse("\x1b[31mred"))
+	assert.NotEmpty(t, pr.fg)
+
+	pr.Reset()
+	assert.Empty(t, pr.fg)
+	assert.Same(t, vga, pr.palette)
+	assert.True(t, pr.useClasses)
+}